@@ -2,6 +2,8 @@ package consumer
 
 import (
 	"bufio"
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -19,6 +21,12 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// maxConsecutiveTokenRefreshes bounds how many times establishWebsocketConnection
+// will call the registered AuthTokenRefresher in a row when the traffic
+// controller keeps rejecting the refreshed token, so a broken token endpoint
+// can't spin the connection attempt forever.
+const maxConsecutiveTokenRefreshes = 3
+
 // TailingLogs listens indefinitely for log messages only; other event types
 // are dropped.
 // Whenever an error is encountered, the error will be sent down the error
@@ -31,13 +39,21 @@ import (
 // Errors must be drained from the returned error channel for it to continue
 // retrying; if they are not drained, the connection attempts will hang.
 func (c *Consumer) TailingLogs(appGuid, authToken string) (<-chan *events.LogMessage, <-chan error) {
-	return c.tailingLogs(appGuid, authToken, maxRetries)
+	return c.tailingLogs(context.Background(), appGuid, authToken, maxRetries)
+}
+
+// TailingLogsWithContext behaves like TailingLogs, except that the
+// subscription is scoped to ctx: cancelling ctx interrupts any in-flight read,
+// stops further reconnect attempts, and closes both returned channels. Other
+// subscriptions on the same Consumer are left running.
+func (c *Consumer) TailingLogsWithContext(ctx context.Context, appGuid, authToken string) (<-chan *events.LogMessage, <-chan error) {
+	return c.tailingLogs(ctx, appGuid, authToken, maxRetries)
 }
 
 // TailingLogsWithoutReconnect functions identically to TailingLogs but without
 // any reconnect attempts when errors occur.
 func (c *Consumer) TailingLogsWithoutReconnect(appGuid string, authToken string) (<-chan *events.LogMessage, <-chan error) {
-	return c.tailingLogs(appGuid, authToken, 0)
+	return c.tailingLogs(context.Background(), appGuid, authToken, 0)
 }
 
 // Stream listens indefinitely for all log and event messages.
@@ -51,13 +67,21 @@ func (c *Consumer) TailingLogsWithoutReconnect(appGuid string, authToken string)
 // failed reconnection attempts, Stream will give up and close the error and
 // Envelope channels.
 func (c *Consumer) Stream(appGuid string, authToken string) (outputChan <-chan *events.Envelope, errorChan <-chan error) {
-	return c.runStream(appGuid, authToken, maxRetries)
+	return c.runStream(context.Background(), appGuid, authToken, maxRetries)
+}
+
+// StreamWithContext behaves like Stream, except that the subscription is
+// scoped to ctx: cancelling ctx interrupts any in-flight read, stops further
+// reconnect attempts, and closes both returned channels. Other subscriptions
+// on the same Consumer are left running.
+func (c *Consumer) StreamWithContext(ctx context.Context, appGuid string, authToken string) (<-chan *events.Envelope, <-chan error) {
+	return c.runStream(ctx, appGuid, authToken, maxRetries)
 }
 
 // StreamWithoutReconnect functions identically to Stream but without any
 // reconnect attempts when errors occur.
 func (c *Consumer) StreamWithoutReconnect(appGuid string, authToken string) (<-chan *events.Envelope, <-chan error) {
-	return c.runStream(appGuid, authToken, 0)
+	return c.runStream(context.Background(), appGuid, authToken, 0)
 }
 
 // Firehose streams all data. All clients with the same subscriptionId will
@@ -73,13 +97,21 @@ func (c *Consumer) StreamWithoutReconnect(appGuid string, authToken string) (<-c
 // failed reconnection attempts, Firehose will give up and close the error and
 // Envelope channels.
 func (c *Consumer) Firehose(subscriptionId string, authToken string) (<-chan *events.Envelope, <-chan error) {
-	return c.firehose(subscriptionId, authToken, 5)
+	return c.firehose(context.Background(), subscriptionId, authToken, 5)
+}
+
+// FirehoseWithContext behaves like Firehose, except that the subscription is
+// scoped to ctx: cancelling ctx interrupts any in-flight read, stops further
+// reconnect attempts, and closes both returned channels. Other subscriptions
+// on the same Consumer are left running.
+func (c *Consumer) FirehoseWithContext(ctx context.Context, subscriptionId string, authToken string) (<-chan *events.Envelope, <-chan error) {
+	return c.firehose(ctx, subscriptionId, authToken, 5)
 }
 
 // FirehoseWithoutReconnect functions identically to Firehose but without any
 // reconnect attempts when errors occur.
 func (c *Consumer) FirehoseWithoutReconnect(subscriptionId string, authToken string) (<-chan *events.Envelope, <-chan error) {
-	return c.firehose(subscriptionId, authToken, 0)
+	return c.firehose(context.Background(), subscriptionId, authToken, 0)
 }
 
 // SetDebugPrinter sets the websocket connection to write debug information to
@@ -127,13 +159,146 @@ func (c *Consumer) SetIdleTimeout(idleTimeout time.Duration) {
 	c.idleTimeout = idleTimeout
 }
 
+// SetProxyHeader sets additional headers to send on the CONNECT request used
+// to establish a tunnel through an HTTP proxy, e.g. a
+// "Proxy-Authorization: Bearer <token>" header for a proxy that authenticates
+// via bearer tokens rather than HTTP basic auth.
+func (c *Consumer) SetProxyHeader(header http.Header) {
+	c.proxyHeaderLock.Lock()
+	defer c.proxyHeaderLock.Unlock()
+	c.proxyHeader = header
+}
+
+func (c *Consumer) getProxyHeader() http.Header {
+	c.proxyHeaderLock.RLock()
+	defer c.proxyHeaderLock.RUnlock()
+	return c.proxyHeader
+}
+
+// SetRetryPolicy sets the RetryPolicy used to back off between reconnect
+// attempts in retryAction. If not set, a FixedBackoff matching noaa's
+// historical behavior (a constant reconnectTimeout between attempts) is used.
+func (c *Consumer) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicyLock.Lock()
+	defer c.retryPolicyLock.Unlock()
+	c.retryPolicy = policy
+}
+
+func (c *Consumer) getRetryPolicy() RetryPolicy {
+	c.retryPolicyLock.RLock()
+	defer c.retryPolicyLock.RUnlock()
+	if c.retryPolicy == nil {
+		return FixedBackoff{Delay: reconnectTimeout}
+	}
+	return c.retryPolicy
+}
+
+// SetAuthTokenRefresher registers a callback used to obtain a fresh bearer
+// token when the traffic controller rejects the current one with a 401. It
+// is invoked on the initial dial as well as on every reconnect; its result
+// replaces the Authorization header on the next dial attempt. An
+// UnauthorizedError is only surfaced to the error channel if no refresher is
+// registered, if the refresher itself fails or returns an empty token, or if
+// the traffic controller still rejects the token after
+// maxConsecutiveTokenRefreshes consecutive refreshes.
+func (c *Consumer) SetAuthTokenRefresher(refresher func(ctx context.Context) (string, error)) {
+	c.authTokenRefresherLock.Lock()
+	defer c.authTokenRefresherLock.Unlock()
+	c.authTokenRefresher = refresher
+}
+
+func (c *Consumer) getAuthTokenRefresher() func(ctx context.Context) (string, error) {
+	c.authTokenRefresherLock.RLock()
+	defer c.authTokenRefresherLock.RUnlock()
+	return c.authTokenRefresher
+}
+
+// SetKeepAlive enables websocket-level health checking on every connection
+// this Consumer opens from now on: a ping is written every interval, and if
+// no pong arrives within 2*interval the websocket is force-closed so the
+// existing retry path reconnects. This catches a half-open TCP connection
+// much sooner than idleTimeout, which never fires on a chatty stream.
+func (c *Consumer) SetKeepAlive(interval, timeout time.Duration) {
+	c.keepAliveLock.Lock()
+	defer c.keepAliveLock.Unlock()
+	c.keepAliveInterval = interval
+	c.keepAliveTimeout = timeout
+}
+
+func (c *Consumer) getKeepAlive() (interval time.Duration, timeout time.Duration, enabled bool) {
+	c.keepAliveLock.RLock()
+	defer c.keepAliveLock.RUnlock()
+	return c.keepAliveInterval, c.keepAliveTimeout, c.keepAliveInterval > 0
+}
+
+// setConnWebsocket installs ws on conn and, if keepalive is enabled, starts
+// pinging it.
+func (c *Consumer) setConnWebsocket(conn *connection, ws *websocket.Conn) {
+	conn.setWebsocket(ws)
+	c.startKeepAlive(conn, ws)
+}
+
+// startKeepAlive pings ws every interval and force-closes it if no pong has
+// been seen for 2*interval, so a half-open connection surfaces as a
+// ReadMessage error instead of silently swallowing envelopes. It exits as
+// soon as conn is closed or swapped to a different websocket.
+func (c *Consumer) startKeepAlive(conn *connection, ws *websocket.Conn) {
+	interval, timeout, enabled := c.getKeepAlive()
+	if !enabled {
+		return
+	}
+
+	ws.SetPongHandler(func(string) error {
+		conn.recordPong()
+		return nil
+	})
+
+	stop := make(chan struct{})
+	conn.lock.Lock()
+	conn.stopPinging = stop
+	conn.lastPong = time.Now()
+	conn.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				conn.lock.Lock()
+				stale := conn.closed || conn.ws != ws
+				conn.lock.Unlock()
+				if stale {
+					return
+				}
+
+				// WriteControl is documented as safe to call concurrently
+				// with other writers, so it must not be made while holding
+				// conn.lock: it can block for up to timeout on a genuinely
+				// stalled connection, which would also stall conn.close()
+				// and conn.setWebsocket() (both take the same lock) for
+				// just as long.
+				if err := ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(timeout)); err != nil {
+					return
+				}
+				if conn.timeSinceLastPong() > 2*interval {
+					ws.Close()
+					return
+				}
+			}
+		}
+	}()
+}
+
 func (c *Consumer) onConnectCallback() func() {
 	c.callbackLock.RLock()
 	defer c.callbackLock.RUnlock()
 	return c.callback
 }
 
-func (c *Consumer) tailingLogs(appGuid, authToken string, retries uint) (<-chan *events.LogMessage, <-chan error) {
+func (c *Consumer) tailingLogs(ctx context.Context, appGuid, authToken string, retries uint) (<-chan *events.LogMessage, <-chan error) {
 	outputs := make(chan *events.LogMessage)
 	errors := make(chan error, 1)
 	callback := func(env *events.Envelope) {
@@ -144,12 +309,12 @@ func (c *Consumer) tailingLogs(appGuid, authToken string, retries uint) (<-chan
 	go func() {
 		defer close(errors)
 		defer close(outputs)
-		c.streamAppData(appGuid, authToken, callback, errors, retries)
+		c.streamAppData(ctx, appGuid, authToken, callback, errors, retries)
 	}()
 	return outputs, errors
 }
 
-func (c *Consumer) runStream(appGuid, authToken string, retries uint) (<-chan *events.Envelope, <-chan error) {
+func (c *Consumer) runStream(ctx context.Context, appGuid, authToken string, retries uint) (<-chan *events.Envelope, <-chan error) {
 	outputs := make(chan *events.Envelope)
 	errors := make(chan error, 1)
 
@@ -160,29 +325,31 @@ func (c *Consumer) runStream(appGuid, authToken string, retries uint) (<-chan *e
 	go func() {
 		defer close(errors)
 		defer close(outputs)
-		c.streamAppData(appGuid, authToken, callback, errors, retries)
+		c.streamAppData(ctx, appGuid, authToken, callback, errors, retries)
 	}()
 	return outputs, errors
 }
 
-func (c *Consumer) streamAppData(appGuid, authToken string, callback func(*events.Envelope), errors chan<- error, retries uint) {
+func (c *Consumer) streamAppData(ctx context.Context, appGuid, authToken string, callback func(*events.Envelope), errors chan<- error, retries uint) {
 	streamPath := fmt.Sprintf("/apps/%s/stream", appGuid)
 	conn := c.newConn(nil)
+	token := authToken
 	action := func() (error, bool) {
 		if conn.Closed() {
 			return nil, true
 		}
-		ws, err := c.establishWebsocketConnection(streamPath, authToken)
+		ws, refreshedToken, err := c.establishWebsocketConnection(ctx, streamPath, token)
+		token = refreshedToken
 		if err != nil {
 			return err, false
 		}
-		conn.setWebsocket(ws)
-		return c.listenForMessages(conn, callback), false
+		c.setConnWebsocket(conn, ws)
+		return c.listenForMessages(ctx, conn, callback), false
 	}
-	c.retryAction(action, errors, retries)
+	c.retryAction(ctx, action, errors, retries)
 }
 
-func (c *Consumer) firehose(subID, authToken string, retries uint) (<-chan *events.Envelope, <-chan error) {
+func (c *Consumer) firehose(ctx context.Context, subID, authToken string, retries uint) (<-chan *events.Envelope, <-chan error) {
 	outputs := make(chan *events.Envelope)
 	errors := make(chan error, 1)
 	callback := func(env *events.Envelope) {
@@ -191,43 +358,68 @@ func (c *Consumer) firehose(subID, authToken string, retries uint) (<-chan *even
 
 	streamPath := "/firehose/" + subID
 	conn := c.newConn(nil)
+	token := authToken
 	action := func() (error, bool) {
 		if conn.Closed() {
 			return nil, true
 		}
-		ws, err := c.establishWebsocketConnection(streamPath, authToken)
+		ws, refreshedToken, err := c.establishWebsocketConnection(ctx, streamPath, token)
+		token = refreshedToken
 		if err != nil {
 			return err, false
 		}
-		conn.setWebsocket(ws)
-		return c.listenForMessages(conn, callback), false
+		c.setConnWebsocket(conn, ws)
+		return c.listenForMessages(ctx, conn, callback), false
 	}
 	go func() {
 		defer close(errors)
 		defer close(outputs)
-		c.retryAction(action, errors, retries)
+		c.retryAction(ctx, action, errors, retries)
 	}()
 	return outputs, errors
 }
 
 func (c *Consumer) stream(streamPath string, authToken string, callback func(*events.Envelope)) error {
-	ws, err := c.establishWebsocketConnection(streamPath, authToken)
+	ctx := context.Background()
+	ws, _, err := c.establishWebsocketConnection(ctx, streamPath, authToken)
 	if err != nil {
 		return err
 	}
 	conn := c.newConn(ws)
+	c.startKeepAlive(conn, ws)
 
-	return c.listenForMessages(conn, callback)
+	return c.listenForMessages(ctx, conn, callback)
 }
 
-func (c *Consumer) listenForMessages(conn *connection, callback func(*events.Envelope)) error {
+func (c *Consumer) listenForMessages(ctx context.Context, conn *connection, callback func(*events.Envelope)) error {
 	ws := conn.websocket()
+
+	// Interrupt a blocked ReadMessage as soon as ctx is cancelled. Unlike a
+	// Consumer.Close(), ctx only scopes this one subscription, so we must
+	// close and forget conn ourselves here: retryAction won't call action()
+	// again to do it (ctx.Done() makes it return immediately), and nothing
+	// else would ever close this socket or drop it from c.conns.
+	cancelled := make(chan struct{})
+	defer close(cancelled)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.close()
+			c.removeConn(conn)
+		case <-cancelled:
+		}
+	}()
+
 	for {
 		if c.idleTimeout != 0 {
 			ws.SetReadDeadline(time.Now().Add(c.idleTimeout))
 		}
 		_, data, err := ws.ReadMessage()
 
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		// If the connection was closed (i.e. if conn.Close() was called), we
 		// will have a non-nil error, but we want to return a nil error.
 		if conn.Closed() {
@@ -248,26 +440,46 @@ func (c *Consumer) listenForMessages(conn *connection, callback func(*events.Env
 	}
 }
 
-func (c *Consumer) retryAction(action func() (err error, done bool), errors chan<- error, retries uint) {
+func (c *Consumer) retryAction(ctx context.Context, action func() (err error, done bool), errors chan<- error, retries uint) {
 	reconnectAttempts := uint(0)
 
 	oldConnectCallback := c.onConnectCallback()
 	defer c.SetOnConnectCallback(oldConnectCallback)
 
-	c.callback = func() {
+	c.SetOnConnectCallback(func() {
 		reconnectAttempts = 0
 		if oldConnectCallback != nil {
 			oldConnectCallback()
 		}
-	}
+	})
+
+	policy := c.getRetryPolicy()
 
 	for ; reconnectAttempts <= retries; reconnectAttempts++ {
+		if ctx.Err() != nil {
+			return
+		}
+
 		err, done := action()
 		if done {
 			return
 		}
 		errors <- err
-		time.Sleep(reconnectTimeout)
+
+		if _, unauthorized := err.(*noaa_errors.UnauthorizedError); unauthorized {
+			return
+		}
+
+		backoff, retry := policy.NextBackoff(reconnectAttempts, err)
+		if !retry {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
 	}
 }
 
@@ -279,41 +491,86 @@ func (c *Consumer) newConn(wsConn *websocket.Conn) *connection {
 	return conn
 }
 
-func (c *Consumer) establishWebsocketConnection(path string, authToken string) (*websocket.Conn, error) {
-	header := http.Header{"Origin": []string{"http://localhost"}, "Authorization": []string{authToken}}
+// removeConn drops conn from c.conns once it has been closed outside of
+// Consumer.Close(), e.g. because its own ctx was cancelled, so it doesn't
+// linger in the slice forever.
+func (c *Consumer) removeConn(conn *connection) {
+	c.connsLock.Lock()
+	defer c.connsLock.Unlock()
+	for i, candidate := range c.conns {
+		if candidate == conn {
+			c.conns = append(c.conns[:i], c.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// establishWebsocketConnection dials the traffic controller at path,
+// presenting authToken as the bearer token. It returns the token actually
+// used to succeed (or to give up), which may differ from authToken if a
+// registered AuthTokenRefresher supplied a new one after a 401 challenge;
+// callers should remember it and pass it back in on the next reconnect.
+func (c *Consumer) establishWebsocketConnection(ctx context.Context, path string, authToken string) (*websocket.Conn, string, error) {
 	url := c.trafficControllerUrl + path
+	token := authToken
+
+	// c.dialer is shared by every concurrent subscription on this Consumer;
+	// NetDialContext never changes once set, so assign it a single time
+	// rather than racing concurrent reconnects over the same field.
+	c.netDialContextOnce.Do(func() {
+		c.dialer.NetDialContext = c.proxyDialContext
+	})
+
+	for refreshAttempts := uint(0); ; refreshAttempts++ {
+		header := http.Header{"Origin": []string{"http://localhost"}, "Authorization": []string{token}}
+
+		c.debugPrinter.Print("WEBSOCKET REQUEST:",
+			"GET "+path+" HTTP/1.1\n"+
+				"Host: "+c.trafficControllerUrl+"\n"+
+				"Upgrade: websocket\nConnection: Upgrade\nSec-WebSocket-Version: 13\nSec-WebSocket-Key: [HIDDEN]\n"+
+				headersString(header))
+
+		ws, resp, err := c.dialer.DialContext(ctx, url, header)
+		if resp != nil {
+			c.debugPrinter.Print("WEBSOCKET RESPONSE:",
+				resp.Proto+" "+resp.Status+"\n"+
+					headersString(resp.Header))
+		}
 
-	c.debugPrinter.Print("WEBSOCKET REQUEST:",
-		"GET "+path+" HTTP/1.1\n"+
-			"Host: "+c.trafficControllerUrl+"\n"+
-			"Upgrade: websocket\nConnection: Upgrade\nSec-WebSocket-Version: 13\nSec-WebSocket-Key: [HIDDEN]\n"+
-			headersString(header))
-
-	ws, resp, err := c.dialer.Dial(url, header)
-	if resp != nil {
-		c.debugPrinter.Print("WEBSOCKET RESPONSE:",
-			resp.Proto+" "+resp.Status+"\n"+
-				headersString(resp.Header))
-	}
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			bodyData, _ := ioutil.ReadAll(resp.Body)
 
-	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
-		bodyData, _ := ioutil.ReadAll(resp.Body)
-		err = noaa_errors.NewUnauthorizedError(string(bodyData))
-		return ws, err
-	}
+			refresher := c.getAuthTokenRefresher()
+			if refresher != nil && refreshAttempts < maxConsecutiveTokenRefreshes {
+				newToken, refreshErr := refresher(ctx)
+				if refreshErr == nil && newToken != "" {
+					token = newToken
+					continue
+				}
+			}
 
-	if err == nil && c.callback != nil {
-		c.callback()
-	}
+			return ws, token, noaa_errors.NewUnauthorizedError(string(bodyData))
+		}
 
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Error dialing traffic controller server: %s.\nPlease ask your Cloud Foundry Operator to check the platform configuration (traffic controller is %s).", err.Error(), c.trafficControllerUrl))
-	}
+		if err == nil {
+			if cb := c.onConnectCallback(); cb != nil {
+				cb()
+			}
+		}
+
+		if err != nil {
+			return nil, token, errors.New(fmt.Sprintf("Error dialing traffic controller server: %s.\nPlease ask your Cloud Foundry Operator to check the platform configuration (traffic controller is %s).", err.Error(), c.trafficControllerUrl))
+		}
 
-	return ws, err
+		return ws, token, err
+	}
 }
 
 func (c *Consumer) proxyDial(network, addr string) (net.Conn, error) {
+	return c.proxyDialContext(context.Background(), network, addr)
+}
+
+func (c *Consumer) proxyDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
 	targetUrl, err := url.Parse("http://" + addr)
 	if err != nil {
 		return nil, err
@@ -328,11 +585,13 @@ func (c *Consumer) proxyDial(network, addr string) (net.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	dialer := &net.Dialer{}
 	if proxyUrl == nil {
-		return net.Dial(network, addr)
+		return dialer.DialContext(ctx, network, addr)
 	}
 
-	proxyConn, err := net.Dial(network, proxyUrl.Host)
+	proxyConn, err := dialer.DialContext(ctx, network, proxyUrl.Host)
 	if err != nil {
 		return nil, err
 	}
@@ -343,6 +602,17 @@ func (c *Consumer) proxyDial(network, addr string) (net.Conn, error) {
 		Host:   targetUrl.Host,
 		Header: make(http.Header),
 	}
+	for name, values := range c.getProxyHeader() {
+		for _, value := range values {
+			connectReq.Header.Add(name, value)
+		}
+	}
+	if proxyUrl.User != nil {
+		if password, ok := proxyUrl.User.Password(); ok {
+			cred := base64.StdEncoding.EncodeToString([]byte(proxyUrl.User.Username() + ":" + password))
+			connectReq.Header.Set("Proxy-Authorization", "Basic "+cred)
+		}
+	}
 	connectReq.Write(proxyConn)
 
 	connectResp, err := http.ReadResponse(bufio.NewReader(proxyConn), connectReq)
@@ -351,9 +621,9 @@ func (c *Consumer) proxyDial(network, addr string) (net.Conn, error) {
 		return nil, err
 	}
 	if connectResp.StatusCode != http.StatusOK {
-		f := strings.SplitN(connectResp.Status, " ", 2)
+		body, _ := ioutil.ReadAll(connectResp.Body)
 		proxyConn.Close()
-		return nil, errors.New(f[1])
+		return nil, fmt.Errorf("proxy CONNECT failed: %s %s\n%s", connectResp.Proto, connectResp.Status, string(body))
 	}
 
 	return proxyConn, nil
@@ -368,9 +638,11 @@ func headersString(header http.Header) string {
 }
 
 type connection struct {
-	ws     *websocket.Conn
-	closed bool
-	lock   sync.Mutex
+	ws          *websocket.Conn
+	closed      bool
+	lock        sync.Mutex
+	lastPong    time.Time
+	stopPinging chan struct{}
 }
 
 func (c *connection) websocket() *websocket.Conn {
@@ -382,13 +654,16 @@ func (c *connection) websocket() *websocket.Conn {
 func (c *connection) setWebsocket(ws *websocket.Conn) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	c.stopKeepAlive()
 	c.ws = ws
+	c.lastPong = time.Now()
 }
 
 func (c *connection) close() error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	c.closed = true
+	c.stopKeepAlive()
 
 	if c.ws == nil {
 		return errors.New("connection does not exist")
@@ -403,3 +678,24 @@ func (c *connection) Closed() bool {
 	defer c.lock.Unlock()
 	return c.closed
 }
+
+// stopKeepAlive tells the ping goroutine started by Consumer.startKeepAlive
+// for the current websocket, if any, to exit. Callers must hold c.lock.
+func (c *connection) stopKeepAlive() {
+	if c.stopPinging != nil {
+		close(c.stopPinging)
+		c.stopPinging = nil
+	}
+}
+
+func (c *connection) recordPong() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lastPong = time.Now()
+}
+
+func (c *connection) timeSinceLastPong() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return time.Since(c.lastPong)
+}
@@ -0,0 +1,95 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestEstablishWebsocketConnectionRefreshesExpiredToken(t *testing.T) {
+	var attempts int32
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "fresh-token" {
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("token expired"))
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatalf("upgrade: %v", err)
+		}
+		ws.Close()
+	}))
+	defer server.Close()
+
+	c := NewConsumer(strings.Replace(server.URL, "http", "ws", 1), nil, nil)
+
+	var refreshCalls int32
+	c.SetAuthTokenRefresher(func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&refreshCalls, 1)
+		return "fresh-token", nil
+	})
+
+	ws, token, err := c.establishWebsocketConnection(context.Background(), "/stream", "stale-token")
+	if err != nil {
+		t.Fatalf("establishWebsocketConnection returned error: %v", err)
+	}
+	defer ws.Close()
+
+	if token != "fresh-token" {
+		t.Fatalf("returned token = %q, want %q", token, "fresh-token")
+	}
+	if got := atomic.LoadInt32(&refreshCalls); got != 1 {
+		t.Fatalf("refresher called %d times, want 1", got)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Fatalf("traffic controller rejected the stale token %d times, want 1", got)
+	}
+}
+
+func TestEstablishWebsocketConnectionSurfacesUnauthorizedWhenNoRefresherRegistered(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("token expired"))
+	}))
+	defer server.Close()
+
+	c := NewConsumer(strings.Replace(server.URL, "http", "ws", 1), nil, nil)
+
+	_, _, err := c.establishWebsocketConnection(context.Background(), "/stream", "stale-token")
+	if err == nil {
+		t.Fatal("expected an UnauthorizedError when no refresher is registered")
+	}
+}
+
+func TestEstablishWebsocketConnectionBoundsConsecutiveRefreshes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("token expired"))
+	}))
+	defer server.Close()
+
+	c := NewConsumer(strings.Replace(server.URL, "http", "ws", 1), nil, nil)
+
+	var refreshCalls int32
+	c.SetAuthTokenRefresher(func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&refreshCalls, 1)
+		return "still-rejected-token", nil
+	})
+
+	_, _, err := c.establishWebsocketConnection(context.Background(), "/stream", "stale-token")
+	if err == nil {
+		t.Fatal("expected an UnauthorizedError once refresh attempts are exhausted")
+	}
+	if got := atomic.LoadInt32(&refreshCalls); got != maxConsecutiveTokenRefreshes {
+		t.Fatalf("refresher called %d times, want %d", got, maxConsecutiveTokenRefreshes)
+	}
+}
@@ -0,0 +1,76 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestTailingLogsWithContextCancelInterruptsReadStopsRetryingAndForgetsConn
+// exercises the ctx-cancellation path end to end: it interrupts a blocked
+// ReadMessage, stops the retry loop without sleeping the configured backoff,
+// closes both returned channels, and drops the connection from c.conns
+// instead of leaking it.
+func TestTailingLogsWithContextCancelInterruptsReadStopsRetryingAndForgetsConn(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	connected := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatalf("upgrade: %v", err)
+		}
+		close(connected)
+		// Never write, so without ctx cancellation this would block forever.
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		ws.ReadMessage()
+	}))
+	defer server.Close()
+
+	c := NewConsumer(strings.Replace(server.URL, "http", "ws", 1), nil, nil)
+	// A backoff far longer than this test's timeout: if cancellation fell
+	// through to retryAction's normal sleep instead of stopping immediately,
+	// the channel-close assertion below would time out.
+	c.SetRetryPolicy(FixedBackoff{Delay: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logs, errs := c.TailingLogsWithContext(ctx, "app-guid", "token")
+
+	<-connected
+	cancel()
+
+	timeout := time.After(2 * time.Second)
+	logsClosed, errsClosed := false, false
+	for !logsClosed || !errsClosed {
+		select {
+		case _, ok := <-logs:
+			if !ok {
+				logsClosed = true
+			}
+		case _, ok := <-errs:
+			if !ok {
+				errsClosed = true
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for TailingLogsWithContext channels to close after ctx cancellation")
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.connsLock.Lock()
+		n := len(c.conns)
+		c.connsLock.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("c.conns has %d entries after cancellation, want 0 (connection should be forgotten, not leaked)", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,112 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestKeepAliveForceClosesConnectionAfterMissedPongs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatalf("upgrade: %v", err)
+		}
+		// Never read, so Pings the client sends are never answered with a Pong.
+		select {}
+	}))
+	defer server.Close()
+
+	c := NewConsumer(strings.Replace(server.URL, "http", "ws", 1), nil, nil)
+	c.SetKeepAlive(10*time.Millisecond, 10*time.Millisecond)
+
+	ws, _, err := c.establishWebsocketConnection(context.Background(), "/stream", "token")
+	if err != nil {
+		t.Fatalf("establishWebsocketConnection: %v", err)
+	}
+	conn := c.newConn(ws)
+	c.startKeepAlive(conn, ws)
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := ws.ReadMessage(); err == nil {
+		t.Fatal("expected ReadMessage to fail once keepalive force-closes the unresponsive connection")
+	}
+}
+
+func TestKeepAlivePongHandlerResetsLastPong(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatalf("upgrade: %v", err)
+		}
+		defer ws.Close()
+		// Answer every Ping with a Pong, as a healthy peer would.
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		ws.ReadMessage()
+	}))
+	defer server.Close()
+
+	c := NewConsumer(strings.Replace(server.URL, "http", "ws", 1), nil, nil)
+	c.SetKeepAlive(10*time.Millisecond, 100*time.Millisecond)
+
+	ws, _, err := c.establishWebsocketConnection(context.Background(), "/stream", "token")
+	if err != nil {
+		t.Fatalf("establishWebsocketConnection: %v", err)
+	}
+	defer ws.Close()
+	conn := c.newConn(ws)
+	c.startKeepAlive(conn, ws)
+
+	// Pongs reach the pong handler only while the client reads from ws, as
+	// listenForMessages does in normal use.
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(150 * time.Millisecond)
+	if since := conn.timeSinceLastPong(); since > 100*time.Millisecond {
+		t.Fatalf("lastPong is %v old, expected pong handler to keep resetting it", since)
+	}
+}
+
+func TestConnectionCloseStopsTheKeepAlivePingGoroutine(t *testing.T) {
+	conn := &connection{ws: nil}
+	stop := make(chan struct{})
+	conn.stopPinging = stop
+
+	conn.close()
+
+	select {
+	case <-stop:
+	default:
+		t.Fatal("expected close() to close stopPinging so the ping goroutine exits")
+	}
+	if conn.stopPinging != nil {
+		t.Fatal("expected close() to clear stopPinging")
+	}
+}
+
+func TestConnectionSetWebsocketStopsThePreviousKeepAlivePingGoroutine(t *testing.T) {
+	conn := &connection{}
+	stop := make(chan struct{})
+	conn.stopPinging = stop
+
+	conn.setWebsocket(nil)
+
+	select {
+	case <-stop:
+	default:
+		t.Fatal("expected setWebsocket() to close the previous stopPinging so its ping goroutine exits")
+	}
+}
@@ -0,0 +1,120 @@
+package consumer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// startFakeConnectProxy listens for a single raw HTTP CONNECT request and
+// hands it to check, which reports whether the request should be allowed
+// through. It writes back a 200 on success or a 407 with a body on failure,
+// the way a real authenticating corporate proxy would.
+func startFakeConnectProxy(t *testing.T, check func(*http.Request) bool) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start fake proxy: %v", err)
+	}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+
+		if check(req) {
+			fmt.Fprint(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+			return
+		}
+		fmt.Fprint(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\nbad credentials")
+	}()
+
+	return listener
+}
+
+func TestProxyDialSendsProxyAuthorizationForBasicAuthProxy(t *testing.T) {
+	const username, password = "user", "s3cr3t"
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+
+	var gotAuth string
+	proxy := startFakeConnectProxy(t, func(r *http.Request) bool {
+		gotAuth = r.Header.Get("Proxy-Authorization")
+		return gotAuth == wantAuth
+	})
+	defer proxy.Close()
+
+	proxyUrl, _ := url.Parse(fmt.Sprintf("http://%s:%s@%s", username, password, proxy.Addr().String()))
+	c := NewConsumer("wss://traffic-controller.example.com", nil, func(*http.Request) (*url.URL, error) {
+		return proxyUrl, nil
+	})
+
+	conn, err := c.proxyDial("tcp", "traffic-controller.example.com:443")
+	if err != nil {
+		t.Fatalf("proxyDial returned error: %v", err)
+	}
+	conn.Close()
+
+	if gotAuth != wantAuth {
+		t.Fatalf("Proxy-Authorization header = %q, want %q", gotAuth, wantAuth)
+	}
+}
+
+func TestProxyDialForwardsCustomProxyHeader(t *testing.T) {
+	const bearer = "Bearer some-proxy-token"
+
+	var gotAuth string
+	proxy := startFakeConnectProxy(t, func(r *http.Request) bool {
+		gotAuth = r.Header.Get("Proxy-Authorization")
+		return gotAuth == bearer
+	})
+	defer proxy.Close()
+
+	proxyUrl, _ := url.Parse("http://" + proxy.Addr().String())
+	c := NewConsumer("wss://traffic-controller.example.com", nil, func(*http.Request) (*url.URL, error) {
+		return proxyUrl, nil
+	})
+	c.SetProxyHeader(http.Header{"Proxy-Authorization": []string{bearer}})
+
+	conn, err := c.proxyDial("tcp", "traffic-controller.example.com:443")
+	if err != nil {
+		t.Fatalf("proxyDial returned error: %v", err)
+	}
+	conn.Close()
+
+	if gotAuth != bearer {
+		t.Fatalf("Proxy-Authorization header = %q, want %q", gotAuth, bearer)
+	}
+}
+
+func TestProxyDialSurfacesConnectFailureStatusAndBody(t *testing.T) {
+	proxy := startFakeConnectProxy(t, func(*http.Request) bool {
+		return false
+	})
+	defer proxy.Close()
+
+	proxyUrl, _ := url.Parse("http://" + proxy.Addr().String())
+	c := NewConsumer("wss://traffic-controller.example.com", nil, func(*http.Request) (*url.URL, error) {
+		return proxyUrl, nil
+	})
+
+	_, err := c.proxyDial("tcp", "traffic-controller.example.com:443")
+	if err == nil {
+		t.Fatal("expected proxyDial to return an error for a non-200 CONNECT response")
+	}
+	if !strings.Contains(err.Error(), "407") || !strings.Contains(err.Error(), "bad credentials") {
+		t.Fatalf("error %q does not surface the CONNECT status and body", err.Error())
+	}
+}
@@ -0,0 +1,64 @@
+package consumer
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how long retryAction should wait before the next
+// reconnect attempt, and whether it should retry at all. attempt is the
+// zero-indexed number of reconnect attempts made so far; lastErr is the error
+// returned by the most recent attempt.
+type RetryPolicy interface {
+	NextBackoff(attempt uint, lastErr error) (time.Duration, bool)
+}
+
+// ExponentialBackoff is a RetryPolicy suited to long-lived firehose
+// consumers: it reconnects quickly after the first failure and backs off
+// exponentially towards Max on repeated failures. When Jitter is true, the
+// delay is chosen uniformly at random between 0 and the computed backoff
+// (full jitter), which keeps many reconnecting clients from retrying in
+// lockstep. MaxAttempts caps the number of retries; 0 means unlimited. Max
+// left at its zero value means uncapped, consistent with MaxAttempts.
+type ExponentialBackoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	Multiplier  float64
+	Jitter      bool
+	MaxAttempts uint
+}
+
+func (b ExponentialBackoff) NextBackoff(attempt uint, lastErr error) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt >= b.MaxAttempts {
+		return 0, false
+	}
+
+	backoff := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if b.Max > 0 && backoff > float64(b.Max) {
+		backoff = float64(b.Max)
+	}
+	if backoff < 0 {
+		backoff = 0
+	}
+
+	if !b.Jitter {
+		return time.Duration(backoff), true
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1)), true
+}
+
+// FixedBackoff is a RetryPolicy that waits a constant Delay between every
+// attempt, matching noaa's historical reconnect behavior. MaxAttempts caps
+// the number of retries; 0 means unlimited.
+type FixedBackoff struct {
+	Delay       time.Duration
+	MaxAttempts uint
+}
+
+func (b FixedBackoff) NextBackoff(attempt uint, lastErr error) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt >= b.MaxAttempts {
+		return 0, false
+	}
+	return b.Delay, true
+}
@@ -0,0 +1,90 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoffWithoutJitterIsDeterministicAndCapped(t *testing.T) {
+	b := ExponentialBackoff{Initial: 10 * time.Millisecond, Max: 100 * time.Millisecond, Multiplier: 2}
+
+	cases := map[uint]time.Duration{
+		0: 10 * time.Millisecond,
+		1: 20 * time.Millisecond,
+		2: 40 * time.Millisecond,
+		5: 100 * time.Millisecond, // would be 320ms uncapped; Max wins
+	}
+	for attempt, want := range cases {
+		got, retry := b.NextBackoff(attempt, nil)
+		if !retry {
+			t.Fatalf("attempt %d: expected retry=true", attempt)
+		}
+		if got != want {
+			t.Fatalf("attempt %d: backoff = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestExponentialBackoffWithZeroMaxIsUncapped(t *testing.T) {
+	b := ExponentialBackoff{Initial: time.Second, Multiplier: 2}
+
+	for attempt := uint(0); attempt < 4; attempt++ {
+		backoff, retry := b.NextBackoff(attempt, nil)
+		if !retry {
+			t.Fatalf("attempt %d: expected retry=true", attempt)
+		}
+		if backoff <= 0 {
+			t.Fatalf("attempt %d: backoff = %v, want > 0 (a zero Max must not clamp to a zero-delay busy-loop)", attempt, backoff)
+		}
+	}
+
+	got, _ := b.NextBackoff(2, nil)
+	if want := 4 * time.Second; got != want {
+		t.Fatalf("attempt 2: backoff = %v, want %v", got, want)
+	}
+}
+
+func TestExponentialBackoffFullJitterStaysWithinBounds(t *testing.T) {
+	b := ExponentialBackoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 10, Jitter: true}
+
+	for attempt := uint(0); attempt < 10; attempt++ {
+		backoff, retry := b.NextBackoff(attempt, nil)
+		if !retry {
+			t.Fatalf("attempt %d: expected retry=true", attempt)
+		}
+		if backoff < 0 || backoff > b.Max {
+			t.Fatalf("attempt %d: backoff %v out of [0, %v]", attempt, backoff, b.Max)
+		}
+	}
+}
+
+func TestExponentialBackoffStopsAfterMaxAttempts(t *testing.T) {
+	b := ExponentialBackoff{Initial: time.Millisecond, Max: time.Second, Multiplier: 2, MaxAttempts: 3}
+
+	if _, retry := b.NextBackoff(2, nil); !retry {
+		t.Fatal("expected retry=true on the last allowed attempt")
+	}
+	if backoff, retry := b.NextBackoff(3, nil); retry || backoff != 0 {
+		t.Fatalf("attempt 3: got (%v, %v), want (0, false) once MaxAttempts is reached", backoff, retry)
+	}
+}
+
+func TestFixedBackoffMatchesDelayUntilMaxAttempts(t *testing.T) {
+	b := FixedBackoff{Delay: 250 * time.Millisecond, MaxAttempts: 2}
+
+	backoff, retry := b.NextBackoff(0, nil)
+	if !retry || backoff != b.Delay {
+		t.Fatalf("attempt 0: got (%v, %v), want (%v, true)", backoff, retry, b.Delay)
+	}
+	if _, retry := b.NextBackoff(2, nil); retry {
+		t.Fatal("expected retry=false once MaxAttempts is reached")
+	}
+}
+
+func TestFixedBackoffWithNoMaxAttemptsNeverStops(t *testing.T) {
+	b := FixedBackoff{Delay: time.Millisecond}
+
+	if _, retry := b.NextBackoff(1000, nil); !retry {
+		t.Fatal("expected retry=true when MaxAttempts is unset")
+	}
+}